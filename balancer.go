@@ -0,0 +1,188 @@
+package kcl
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// BalancerConfig controls how a leaseBalancer rebalances shard leases
+// across the fleet.
+type BalancerConfig struct {
+	// RebalanceInterval is how often the balancer re-evaluates lease
+	// ownership and steals leases to even out the distribution.
+	RebalanceInterval time.Duration
+
+	// MaxLeasesPerWorker caps how many leases a single worker will hold,
+	// even if its fair share would otherwise be higher. Zero means no
+	// cap.
+	MaxLeasesPerWorker int
+
+	// LeaseDuration is how long a stolen lease is held before it must be
+	// renewed again.
+	LeaseDuration time.Duration
+}
+
+// leaseBalancer periodically lists every lease in the table, groups them
+// by worker, and tries to take leases from peers until the local worker
+// holds its fair share. Only leases that have already expired change
+// hands: a peer's live lease is refused by AcquireLease and stays with
+// that peer.
+type leaseBalancer struct {
+	checkpointer Checkpointer
+	workerID     string
+	config       BalancerConfig
+}
+
+func newLeaseBalancer(checkpointer Checkpointer, workerID string, config BalancerConfig) *leaseBalancer {
+	return &leaseBalancer{
+		checkpointer: checkpointer,
+		workerID:     workerID,
+		config:       config,
+	}
+}
+
+// run blocks, rebalancing on every tick of config.RebalanceInterval until
+// ctx is cancelled.
+func (b *leaseBalancer) run(ctx context.Context) {
+	ticker := time.NewTicker(b.config.RebalanceInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := b.rebalanceOnce(ctx); err != nil {
+				log.WithField("error", err).Error("lease balancer: rebalance failed")
+			}
+		}
+	}
+}
+
+// rebalanceOnce computes the local worker's fair share of shards and, if
+// it holds fewer than that, steals leases from peers using the same
+// conditional AcquireLease primitive workers use to claim unowned
+// shards. AcquireLease is passed the current time, so a candidate whose
+// lease has not yet expired is refused with ErrLeaseNotAcquired and
+// skipped.
+func (b *leaseBalancer) rebalanceOnce(ctx context.Context) error {
+	leases, err := b.checkpointer.ListLeases(ctx)
+	if err != nil {
+		return err
+	}
+
+	byWorker := make(map[string][]*ShardRecord)
+	for _, lease := range leases {
+		byWorker[lease.WorkerID] = append(byWorker[lease.WorkerID], lease)
+	}
+	if _, ok := byWorker[b.workerID]; !ok {
+		byWorker[b.workerID] = nil
+	}
+
+	fairShare := int(math.Ceil(float64(len(leases)) / float64(len(byWorker))))
+	if b.config.MaxLeasesPerWorker > 0 && fairShare > b.config.MaxLeasesPerWorker {
+		fairShare = b.config.MaxLeasesPerWorker
+	}
+
+	held := len(byWorker[b.workerID])
+	if held >= fairShare {
+		return nil
+	}
+
+	for _, candidate := range selectStealCandidates(byWorker, b.workerID, fairShare-held) {
+		now := time.Now().Unix()
+		newExpiration := time.Now().Add(b.config.LeaseDuration).Unix()
+		err := b.checkpointer.AcquireLease(ctx, candidate.ShardID, b.workerID, now, newExpiration)
+		if err != nil && !errors.Is(err, ErrLeaseNotAcquired) {
+			log.WithFields(log.Fields{
+				"error":   err,
+				"shardID": candidate.ShardID,
+			}).Error("lease balancer: unable to steal lease")
+		}
+	}
+
+	return nil
+}
+
+// selectStealCandidates picks up to `needed` leases to take from peers:
+// leases whose lease has already expired are preferred, oldest first,
+// since stealing those doesn't interrupt anyone; failing that it falls
+// back to taking from whichever peer currently holds the most leases.
+func selectStealCandidates(byWorker map[string][]*ShardRecord, selfWorkerID string, needed int) []*ShardRecord {
+	if needed <= 0 {
+		return nil
+	}
+
+	now := time.Now().Unix()
+	var expired []*ShardRecord
+	for workerID, leases := range byWorker {
+		if workerID == selfWorkerID {
+			continue
+		}
+		for _, lease := range leases {
+			if lease.LeaseExpiration < now {
+				expired = append(expired, lease)
+			}
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool {
+		return expired[i].LeaseExpiration < expired[j].LeaseExpiration
+	})
+
+	candidates := make([]*ShardRecord, 0, needed)
+	for _, lease := range expired {
+		if len(candidates) == needed {
+			return candidates
+		}
+		candidates = append(candidates, lease)
+	}
+
+	stolen := make(map[string]bool, len(candidates))
+	for _, lease := range candidates {
+		stolen[lease.ShardID] = true
+	}
+
+	for len(candidates) < needed {
+		mostOverloaded, lease := mostOverloadedPeer(byWorker, selfWorkerID, stolen)
+		if mostOverloaded == "" {
+			break
+		}
+		stolen[lease.ShardID] = true
+		candidates = append(candidates, lease)
+	}
+
+	return candidates
+}
+
+// mostOverloadedPeer returns the worker (other than selfWorkerID) holding
+// the most not-yet-selected leases, along with one of its leases to
+// steal.
+func mostOverloadedPeer(byWorker map[string][]*ShardRecord, selfWorkerID string, exclude map[string]bool) (string, *ShardRecord) {
+	var bestWorkerID string
+	var bestLease *ShardRecord
+	bestCount := 0
+
+	for workerID, leases := range byWorker {
+		if workerID == selfWorkerID {
+			continue
+		}
+		remaining := leases[:0:0]
+		for _, lease := range leases {
+			if !exclude[lease.ShardID] {
+				remaining = append(remaining, lease)
+			}
+		}
+		if len(remaining) > bestCount {
+			bestCount = len(remaining)
+			bestWorkerID = workerID
+			bestLease = remaining[0]
+		}
+	}
+
+	return bestWorkerID, bestLease
+}
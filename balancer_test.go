@@ -0,0 +1,103 @@
+package kcl
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// fakeCheckpointer is a minimal Checkpointer good enough to drive
+// rebalanceOnce in tests without pulling in a real backend package (which
+// would import this package and create an import cycle from an internal
+// test file).
+type fakeCheckpointer struct {
+	leases map[string]*ShardRecord
+}
+
+func newFakeCheckpointer() *fakeCheckpointer {
+	return &fakeCheckpointer{leases: make(map[string]*ShardRecord)}
+}
+
+func (f *fakeCheckpointer) ValidateTable(ctx context.Context) error { return nil }
+
+func (f *fakeCheckpointer) Checkpoint(ctx context.Context, shardID, seqNum, leaseExpiration, workerID string) error {
+	return nil
+}
+
+func (f *fakeCheckpointer) AcquireLease(ctx context.Context, shardID, workerID string, currentLeaseExpiration, newLeaseExpiration int64) error {
+	if existing, ok := f.leases[shardID]; ok && existing.WorkerID != workerID && existing.LeaseExpiration >= currentLeaseExpiration {
+		return ErrLeaseNotAcquired
+	}
+	f.leases[shardID] = &ShardRecord{ShardID: shardID, WorkerID: workerID, LeaseExpiration: newLeaseExpiration}
+	return nil
+}
+
+func (f *fakeCheckpointer) GetShardData(ctx context.Context, shards []string) (map[string]*ShardRecord, error) {
+	return nil, nil
+}
+
+func (f *fakeCheckpointer) ListLeases(ctx context.Context) ([]*ShardRecord, error) {
+	leases := make([]*ShardRecord, 0, len(f.leases))
+	for _, lease := range f.leases {
+		leases = append(leases, lease)
+	}
+	return leases, nil
+}
+
+func (f *fakeCheckpointer) Close() error { return nil }
+
+var _ Checkpointer = (*fakeCheckpointer)(nil)
+
+// TestRebalanceOnceStealsExpiredLease is a regression test for a bug
+// where rebalanceOnce passed the candidate's own stale LeaseExpiration as
+// the "current time" argument to AcquireLease, so the expiry check
+// (stored < stored) was never true and every steal attempt failed
+// silently.
+func TestRebalanceOnceStealsExpiredLease(t *testing.T) {
+	ctx := context.Background()
+	checkpointer := newFakeCheckpointer()
+
+	checkpointer.leases["shard-1"] = &ShardRecord{
+		ShardID:         "shard-1",
+		WorkerID:        "peer",
+		LeaseExpiration: time.Now().Add(-time.Hour).Unix(),
+	}
+
+	b := newLeaseBalancer(checkpointer, "self", BalancerConfig{LeaseDuration: time.Minute})
+
+	if err := b.rebalanceOnce(ctx); err != nil {
+		t.Fatalf("rebalanceOnce: %v", err)
+	}
+
+	if got := checkpointer.leases["shard-1"].WorkerID; got != "self" {
+		t.Fatalf("shard-1 owner = %q, want %q (expired lease should have been stolen)", got, "self")
+	}
+}
+
+func TestSelectStealCandidatesPrefersExpiredLeases(t *testing.T) {
+	now := time.Now().Unix()
+	byWorker := map[string][]*ShardRecord{
+		"peer": {
+			{ShardID: "live", LeaseExpiration: now + 1000},
+			{ShardID: "expired", LeaseExpiration: now - 1000},
+		},
+	}
+
+	candidates := selectStealCandidates(byWorker, "self", 1)
+	if len(candidates) != 1 || candidates[0].ShardID != "expired" {
+		t.Fatalf("selectStealCandidates() = %+v, want the expired lease", candidates)
+	}
+}
+
+func TestMostOverloadedPeer(t *testing.T) {
+	byWorker := map[string][]*ShardRecord{
+		"self": {{ShardID: "own"}},
+		"a":    {{ShardID: "a-1"}},
+		"b":    {{ShardID: "b-1"}, {ShardID: "b-2"}},
+	}
+
+	workerID, lease := mostOverloadedPeer(byWorker, "self", map[string]bool{})
+	if workerID != "b" || lease == nil {
+		t.Fatalf("mostOverloadedPeer() = (%q, %+v), want worker \"b\"", workerID, lease)
+	}
+}
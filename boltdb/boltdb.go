@@ -0,0 +1,169 @@
+// Package boltdb provides a Checkpointer backed by a local BoltDB file.
+// It is intended for single-node or local-development use: a Bolt-backed
+// store gives the same lease semantics as dynamo without needing
+// DynamoDB Local's JVM for integration testing.
+package boltdb
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/boltdb/bolt"
+	kcl "github.com/suicidejack/kinesis_client_library"
+)
+
+var leaseBucket = []byte("leases")
+
+// Checkpointer is a BoltDB-backed Checkpointer. Each shard row is stored
+// as a bucket keyed by shard_id, with one key per ShardRecord field.
+type Checkpointer struct {
+	db *bolt.DB
+}
+
+// New opens (creating if necessary) the Bolt database at path and
+// returns a Checkpointer backed by it.
+func New(path string) (*Checkpointer, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Checkpointer{db: db}, nil
+}
+
+// ValidateTable ensures the lease bucket exists.
+func (c *Checkpointer) ValidateTable(ctx context.Context) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(leaseBucket)
+		return err
+	})
+}
+
+// AcquireLease runs inside a single Bolt write transaction: it reads the
+// worker_id/lease_expiration keys out of the shard's nested bucket (a
+// bucket not existing yet reads back as an empty lease, same as nobody
+// owning it) and only overwrites them if that read shows an expired or
+// self-owned lease, relying on Bolt's single-writer lock in place of a
+// DynamoDB-style ConditionExpression.
+func (c *Checkpointer) AcquireLease(ctx context.Context, shardID, workerID string, currentLeaseExpiration, newLeaseExpiration int64) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(leaseBucket)
+		if err != nil {
+			return err
+		}
+
+		shard, err := bucket.CreateBucketIfNotExists([]byte(shardID))
+		if err != nil {
+			return err
+		}
+
+		if existingWorkerID := string(shard.Get([]byte("worker_id"))); existingWorkerID != "" && existingWorkerID != workerID {
+			existingExpiration, _ := strconv.ParseInt(string(shard.Get([]byte("lease_expiration"))), 10, 64)
+			if existingExpiration >= currentLeaseExpiration {
+				return kcl.ErrLeaseNotAcquired
+			}
+		}
+
+		if err := shard.Put([]byte("shard_id"), []byte(shardID)); err != nil {
+			return err
+		}
+		if err := shard.Put([]byte("worker_id"), []byte(workerID)); err != nil {
+			return err
+		}
+		return shard.Put([]byte("lease_expiration"), []byte(strconv.FormatInt(newLeaseExpiration, 10)))
+	})
+}
+
+// Checkpoint checks the shard's existing bucket (if any) against workerID
+// and leaseExpiration before writing seqNum, failing with
+// ErrLeaseNotAcquired under the same write-transaction lock AcquireLease
+// uses so the two can never race each other on the same shard.
+func (c *Checkpointer) Checkpoint(ctx context.Context, shardID, seqNum, leaseExpiration, workerID string) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(leaseBucket)
+		if err != nil {
+			return err
+		}
+
+		shard := bucket.Bucket([]byte(shardID))
+		if shard != nil {
+			existingWorkerID := string(shard.Get([]byte("worker_id")))
+			existingExpiration := string(shard.Get([]byte("lease_expiration")))
+			if existingWorkerID != workerID || existingExpiration != leaseExpiration {
+				return kcl.ErrLeaseNotAcquired
+			}
+		} else if shard, err = bucket.CreateBucketIfNotExists([]byte(shardID)); err != nil {
+			return err
+		}
+
+		if err := shard.Put([]byte("shard_id"), []byte(shardID)); err != nil {
+			return err
+		}
+		if err := shard.Put([]byte("worker_id"), []byte(workerID)); err != nil {
+			return err
+		}
+		if err := shard.Put([]byte("lease_expiration"), []byte(leaseExpiration)); err != nil {
+			return err
+		}
+		return shard.Put([]byte("checkpoint"), []byte(seqNum))
+	})
+}
+
+// GetShardData opens the shard bucket for each requested shard ID inside
+// a single read transaction, skipping any shard that has no bucket yet.
+func (c *Checkpointer) GetShardData(ctx context.Context, shards []string) (map[string]*kcl.ShardRecord, error) {
+	records := make(map[string]*kcl.ShardRecord)
+	err := c.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(leaseBucket)
+		if bucket == nil {
+			return nil
+		}
+		for _, shardID := range shards {
+			shard := bucket.Bucket([]byte(shardID))
+			if shard == nil {
+				continue
+			}
+			records[shardID] = shardRecordFromBucket(shard)
+		}
+		return nil
+	})
+	return records, err
+}
+
+// ListLeases returns every shard record currently stored in the
+// database.
+func (c *Checkpointer) ListLeases(ctx context.Context) ([]*kcl.ShardRecord, error) {
+	var records []*kcl.ShardRecord
+	err := c.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(leaseBucket)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(shardID, v []byte) error {
+			if v != nil {
+				// not a nested bucket, skip
+				return nil
+			}
+			shard := bucket.Bucket(shardID)
+			records = append(records, shardRecordFromBucket(shard))
+			return nil
+		})
+	})
+	return records, err
+}
+
+// Close closes the underlying Bolt database.
+func (c *Checkpointer) Close() error {
+	return c.db.Close()
+}
+
+func shardRecordFromBucket(shard *bolt.Bucket) *kcl.ShardRecord {
+	leaseExpiration, _ := strconv.ParseInt(string(shard.Get([]byte("lease_expiration"))), 10, 64)
+	return &kcl.ShardRecord{
+		ShardID:         string(shard.Get([]byte("shard_id"))),
+		Checkpoint:      string(shard.Get([]byte("checkpoint"))),
+		LeaseExpiration: leaseExpiration,
+		WorkerID:        string(shard.Get([]byte("worker_id"))),
+	}
+}
+
+var _ kcl.Checkpointer = (*Checkpointer)(nil)
@@ -0,0 +1,39 @@
+package kcl
+
+import "context"
+
+// Checkpointer is the shard state backend used by the worker to track
+// lease ownership and processing progress. dynamo is the reference
+// DynamoDB-backed implementation; the inmem and boltdb packages provide
+// alternative backends for tests and single-node/local use that don't
+// require a live DynamoDB table.
+//
+// Every method that may talk to a remote store takes a context.Context so
+// callers can bound or cancel the call, for example during graceful
+// worker shutdown.
+type Checkpointer interface {
+	// ValidateTable ensures the backing store is ready to use, creating it
+	// if necessary.
+	ValidateTable(ctx context.Context) error
+
+	// Checkpoint records the sequence number processed so far for shardID.
+	// Implementations must reject the write with ErrLeaseNotAcquired if
+	// workerID no longer holds the lease it believes it does.
+	Checkpoint(ctx context.Context, shardID, seqNum, leaseExpiration, workerID string) error
+
+	// AcquireLease attempts to take (or renew) ownership of shardID for
+	// workerID, failing with ErrLeaseNotAcquired if another worker already
+	// holds an unexpired lease.
+	AcquireLease(ctx context.Context, shardID, workerID string, currentLeaseExpiration, newLeaseExpiration int64) error
+
+	// GetShardData returns the current shard records for the given shard
+	// IDs, keyed by shard ID.
+	GetShardData(ctx context.Context, shards []string) (map[string]*ShardRecord, error)
+
+	// ListLeases returns every shard record currently known to the store,
+	// regardless of which worker owns it.
+	ListLeases(ctx context.Context) ([]*ShardRecord, error)
+
+	// Close releases any resources held by the checkpointer.
+	Close() error
+}
@@ -1,25 +1,60 @@
 package kcl
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strconv"
 	"time"
 
-	log "github.com/Sirupsen/logrus"
-	"github.com/awslabs/aws-sdk-go/aws"
-	"github.com/awslabs/aws-sdk-go/aws/awserr"
-	"github.com/awslabs/aws-sdk-go/aws/awsutil"
-	"github.com/awslabs/aws-sdk-go/service/dynamodb"
+	log "github.com/sirupsen/logrus"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
 
-type shardRecord struct {
+// ErrLeaseNotAcquired is returned by AcquireLease and Checkpoint when the
+// conditional write failed because another worker already holds (or just
+// stole) the lease for the shard. Callers should treat this as a signal to
+// drop the shard rather than retry indefinitely.
+var ErrLeaseNotAcquired = errors.New("dynamo: lease not acquired")
+
+// conditionalCheckFailed reports whether err is a DynamoDB
+// ConditionalCheckFailedException, which is how the service signals that a
+// ConditionExpression did not match the current item.
+func conditionalCheckFailed(err error) bool {
+	var condErr *types.ConditionalCheckFailedException
+	return errors.As(err, &condErr)
+}
+
+// dynamoAPI is the subset of *dynamodb.Client that dynamo calls. Scoping
+// it to just these methods lets tests exercise reconcileTable,
+// AcquireLease, and Checkpoint's condition-expression logic against a
+// fake instead of a live DynamoDB table.
+type dynamoAPI interface {
+	CreateTable(ctx context.Context, params *dynamodb.CreateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error)
+	DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error)
+	UpdateTable(ctx context.Context, params *dynamodb.UpdateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateTableOutput, error)
+	DescribeTimeToLive(ctx context.Context, params *dynamodb.DescribeTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTimeToLiveOutput, error)
+	UpdateTimeToLive(ctx context.Context, params *dynamodb.UpdateTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateTimeToLiveOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error)
+	Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+	ListTagsOfResource(ctx context.Context, params *dynamodb.ListTagsOfResourceInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ListTagsOfResourceOutput, error)
+	TagResource(ctx context.Context, params *dynamodb.TagResourceInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TagResourceOutput, error)
+	UntagResource(ctx context.Context, params *dynamodb.UntagResourceInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UntagResourceOutput, error)
+}
+
+type ShardRecord struct {
 	ShardID         string
 	Checkpoint      string
 	LeaseExpiration int64
 	WorkerID        string
 }
 
-func (s shardRecord) String() string {
+func (s ShardRecord) String() string {
 	return fmt.Sprintf("ShardID: %s, Checkpoint: %s, LeaseExpiration: %d, WorkerID: %s",
 		s.ShardID,
 		s.Checkpoint,
@@ -29,69 +64,255 @@ func (s shardRecord) String() string {
 }
 
 type dynamo struct {
-	db            *dynamodb.DynamoDB
+	db            dynamoAPI
 	tableName     string
 	readCapacity  int64
 	writeCapacity int64
+	options       TableOptions
+}
+
+// newDynamo builds a dynamo backed by the default AWS config (shared
+// config files, environment variables, EC2/ECS role credentials, etc).
+// Use newDynamoWithClient instead when a custom endpoint, credentials, or
+// retryer is needed.
+func newDynamo(ctx context.Context, name string, readCapacity, writeCapacity int64, options TableOptions) (*dynamo, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return newDynamoWithClient(dynamodb.NewFromConfig(cfg), name, readCapacity, writeCapacity, options), nil
 }
 
-func newDynamo(name string, readCapacity, writeCapacity int64) *dynamo {
-	cfg := aws.DefaultConfig
+// newDynamoWithClient builds a dynamo backed by a caller-supplied
+// dynamodb.Client, letting callers inject a custom endpoint, credentials,
+// or retryer instead of relying on the default config. Tests use this to
+// inject a fake dynamoAPI instead of a real client.
+func newDynamoWithClient(client dynamoAPI, name string, readCapacity, writeCapacity int64, options TableOptions) *dynamo {
 	return &dynamo{
-		db:            dynamodb.New(cfg),
+		db:            client,
 		tableName:     name,
 		readCapacity:  readCapacity,
 		writeCapacity: writeCapacity,
+		options:       options,
 	}
 }
 
-func (d *dynamo) ValidateTable() (err error) {
-	err = d.findTable()
-	if awserr, ok := err.(awserr.Error); ok {
-		log.WithField("error", awserr).Error("awserror: unable to describe table")
-		if awserr.Code() == "ResourceNotFoundException" {
-			log.Error("we should create the table here")
-			err = d.createTable()
-		}
-	} else {
+func (d *dynamo) ValidateTable(ctx context.Context) (err error) {
+	output, err := d.findTable(ctx)
+	var notFound *types.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		log.Error("we should create the table here")
+		return d.createTable(ctx)
+	} else if err != nil {
+		log.WithField("error", err).Error("unable to describe table")
+		return err
 	}
-	return
+
+	return d.reconcileTable(ctx, output)
 }
 
-func (d *dynamo) findTable() error {
+func (d *dynamo) findTable(ctx context.Context) (*dynamodb.DescribeTableOutput, error) {
 	input := &dynamodb.DescribeTableInput{
 		TableName: aws.String(d.tableName),
 	}
-	output, err := d.db.DescribeTable(input)
+	output, err := d.db.DescribeTable(ctx, input)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if !isValidTableSchema(output) {
-		return fmt.Errorf("dynamo: invalid table schema")
+		return nil, fmt.Errorf("dynamo: invalid table schema")
+	}
+	return output, nil
+}
+
+// isValidTableSchema reports whether an existing table's key schema
+// matches what this package expects: a single hash key named "shard_id".
+func isValidTableSchema(output *dynamodb.DescribeTableOutput) bool {
+	if output == nil || output.Table == nil {
+		return false
+	}
+	for _, key := range output.Table.KeySchema {
+		if key.KeyType == types.KeyTypeHash {
+			return key.AttributeName != nil && *key.AttributeName == "shard_id"
+		}
+	}
+	return false
+}
+
+// reconcileTable brings an existing table's billing mode and TTL setting
+// in line with d.options, issuing UpdateTable/UpdateTimeToLive calls only
+// when the live table has drifted from the desired configuration. This
+// mirrors how the Terraform DynamoDB resource updates throughput and TTL
+// in place rather than recreating the table.
+func (d *dynamo) reconcileTable(ctx context.Context, output *dynamodb.DescribeTableOutput) error {
+	table := output.Table
+
+	// BillingMode and SSESpecification are merged into a single
+	// UpdateTableInput below: DynamoDB rejects a second UpdateTable call
+	// while the first is still in progress (ResourceInUseException), and a
+	// billing-mode switch is exactly the kind of change that takes real
+	// time to settle.
+	update := &dynamodb.UpdateTableInput{TableName: aws.String(d.tableName)}
+	needsUpdate := false
+
+	desiredBillingMode := d.options.billingMode()
+	currentBillingMode := types.BillingModeProvisioned
+	if table.BillingModeSummary != nil && table.BillingModeSummary.BillingMode != "" {
+		currentBillingMode = table.BillingModeSummary.BillingMode
+	}
+	if currentBillingMode != desiredBillingMode {
+		update.BillingMode = desiredBillingMode
+		if desiredBillingMode == types.BillingModeProvisioned {
+			update.ProvisionedThroughput = &types.ProvisionedThroughput{
+				ReadCapacityUnits:  aws.Int64(d.readCapacity),
+				WriteCapacityUnits: aws.Int64(d.writeCapacity),
+			}
+		}
+		needsUpdate = true
+	}
+
+	desiredSSEEnabled := d.options.SSESpecification != nil && aws.ToBool(d.options.SSESpecification.Enabled)
+	currentSSEEnabled := table.SSEDescription != nil && table.SSEDescription.Status == types.SSEStatusEnabled
+	if desiredSSEEnabled != currentSSEEnabled {
+		sseSpec := d.options.SSESpecification
+		if sseSpec == nil {
+			sseSpec = &types.SSESpecification{Enabled: aws.Bool(false)}
+		}
+		update.SSESpecification = sseSpec
+		needsUpdate = true
+	}
+
+	if needsUpdate {
+		if _, err := d.db.UpdateTable(ctx, update); err != nil {
+			log.WithField("error", err).Error("unable to update table")
+			return err
+		}
+		// Wait for the table to leave UPDATING before issuing any further
+		// UpdateTable/UpdateTimeToLive calls, which DynamoDB also rejects
+		// while a table is mid-update.
+		if err := d.validateTableCreated(ctx); err != nil {
+			return err
+		}
 	}
+
+	if err := d.reconcileTTL(ctx, table); err != nil {
+		return err
+	}
+
+	return d.reconcileTags(ctx, table.TableArn)
+}
+
+// reconcileTTL issues an UpdateTimeToLive call when the table's TTL
+// setting doesn't match d.options.EnableTTL.
+func (d *dynamo) reconcileTTL(ctx context.Context, table *types.TableDescription) error {
+	ttlOutput, err := d.db.DescribeTimeToLive(ctx, &dynamodb.DescribeTimeToLiveInput{
+		TableName: aws.String(d.tableName),
+	})
+	if err != nil {
+		log.WithField("error", err).Error("unable to describe time to live")
+		return err
+	}
+	ttlEnabled := ttlOutput.TimeToLiveDescription != nil &&
+		ttlOutput.TimeToLiveDescription.TimeToLiveStatus == types.TimeToLiveStatusEnabled
+	if ttlEnabled == d.options.EnableTTL {
+		return nil
+	}
+
+	_, err = d.db.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+		TableName: aws.String(d.tableName),
+		TimeToLiveSpecification: &types.TimeToLiveSpecification{
+			AttributeName: aws.String(leaseExpirationTTLAttribute),
+			Enabled:       aws.Bool(d.options.EnableTTL),
+		},
+	})
+	if err != nil {
+		log.WithField("error", err).Error("unable to update time to live")
+	}
+	return err
+}
+
+// reconcileTags adds and removes tags on the table until they match
+// d.options.Tags exactly.
+func (d *dynamo) reconcileTags(ctx context.Context, tableArn *string) error {
+	current := make(map[string]string)
+	listInput := &dynamodb.ListTagsOfResourceInput{ResourceArn: tableArn}
+	for {
+		out, err := d.db.ListTagsOfResource(ctx, listInput)
+		if err != nil {
+			log.WithField("error", err).Error("unable to list table tags")
+			return err
+		}
+		for _, tag := range out.Tags {
+			current[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+		}
+		if out.NextToken == nil {
+			break
+		}
+		listInput.NextToken = out.NextToken
+	}
+
+	desired := make(map[string]string, len(d.options.Tags))
+	for _, tag := range d.options.Tags {
+		desired[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+
+	var toRemove []string
+	for key, value := range current {
+		if desiredValue, ok := desired[key]; !ok || desiredValue != value {
+			toRemove = append(toRemove, key)
+		}
+	}
+	if len(toRemove) > 0 {
+		if _, err := d.db.UntagResource(ctx, &dynamodb.UntagResourceInput{
+			ResourceArn: tableArn,
+			TagKeys:     toRemove,
+		}); err != nil {
+			log.WithField("error", err).Error("unable to remove table tags")
+			return err
+		}
+	}
+
+	if len(d.options.Tags) > 0 {
+		if _, err := d.db.TagResource(ctx, &dynamodb.TagResourceInput{
+			ResourceArn: tableArn,
+			Tags:        d.options.Tags,
+		}); err != nil {
+			log.WithField("error", err).Error("unable to add table tags")
+			return err
+		}
+	}
+
 	return nil
 }
 
-func (d *dynamo) createTable() (err error) {
+func (d *dynamo) createTable(ctx context.Context) (err error) {
 	tableDefinition := &dynamodb.CreateTableInput{
-		TableName:            aws.String(d.tableName),
-		AttributeDefinitions: make([]*dynamodb.AttributeDefinition, 1, 1),
-		KeySchema:            make([]*dynamodb.KeySchemaElement, 1, 1),
-		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
-			ReadCapacityUnits:  aws.Long(d.readCapacity),
-			WriteCapacityUnits: aws.Long(d.writeCapacity),
+		TableName: aws.String(d.tableName),
+		AttributeDefinitions: []types.AttributeDefinition{
+			{
+				AttributeName: aws.String("shard_id"),
+				AttributeType: types.ScalarAttributeTypeS,
+			},
 		},
+		KeySchema: []types.KeySchemaElement{
+			{
+				AttributeName: aws.String("shard_id"),
+				KeyType:       types.KeyTypeHash,
+			},
+		},
+		BillingMode:      d.options.billingMode(),
+		SSESpecification: d.options.SSESpecification,
+		Tags:             d.options.Tags,
 	}
-	tableDefinition.KeySchema[0] = &dynamodb.KeySchemaElement{
-		AttributeName: aws.String("shard_id"),
-		KeyType:       aws.String("HASH"),
-	}
-	tableDefinition.AttributeDefinitions[0] = &dynamodb.AttributeDefinition{
-		AttributeName: aws.String("shard_id"),
-		AttributeType: aws.String("S"),
+	if d.options.billingMode() == types.BillingModeProvisioned {
+		tableDefinition.ProvisionedThroughput = &types.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(d.readCapacity),
+			WriteCapacityUnits: aws.Int64(d.writeCapacity),
+		}
 	}
+
 	var out *dynamodb.CreateTableOutput
-	out, err = d.db.CreateTable(tableDefinition)
+	out, err = d.db.CreateTable(ctx, tableDefinition)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"error": err,
@@ -101,87 +322,142 @@ func (d *dynamo) createTable() (err error) {
 	}
 	if out != nil && out.TableDescription != nil {
 		log.WithFields(log.Fields{
-			"TableStatus": stringPtrToString(out.TableDescription.TableStatus),
+			"TableStatus": out.TableDescription.TableStatus,
 			"TableName":   d.tableName,
 		}).Debug("created dynamodb table")
 	}
 
-	d.validateTableCreated()
+	if err = d.validateTableCreated(ctx); err != nil {
+		return err
+	}
 
-	return
+	if d.options.EnableTTL {
+		_, err = d.db.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+			TableName: aws.String(d.tableName),
+			TimeToLiveSpecification: &types.TimeToLiveSpecification{
+				AttributeName: aws.String(leaseExpirationTTLAttribute),
+				Enabled:       aws.Bool(true),
+			},
+		})
+		if err != nil {
+			log.WithField("error", err).Error("unable to enable time to live")
+			return err
+		}
+	}
+
+	return nil
 }
 
 // blocks until the table status comes back as "ACTIVE"
-func (d *dynamo) validateTableCreated() {
-	input := &dynamodb.DescribeTableInput{
+func (d *dynamo) validateTableCreated(ctx context.Context) error {
+	waiter := dynamodb.NewTableExistsWaiter(d.db)
+	return waiter.Wait(ctx, &dynamodb.DescribeTableInput{
 		TableName: aws.String(d.tableName),
+	}, 5*time.Minute)
+}
+
+// AcquireLease attempts to take ownership of shardID for workerID. The
+// write only succeeds if nobody currently owns the shard, the existing
+// lease has expired, or workerID already owns it (renewal). Any other
+// worker holding a live lease causes the conditional write to fail and
+// ErrLeaseNotAcquired is returned so the caller can back off the shard.
+func (d *dynamo) AcquireLease(ctx context.Context, shardID, workerID string, currentLeaseExpiration, newLeaseExpiration int64) (err error) {
+	updateExpression := "SET lease_expiration = :new_expiration, worker_id = :self"
+	values := map[string]types.AttributeValue{
+		":new_expiration": &types.AttributeValueMemberN{Value: strconv.FormatInt(newLeaseExpiration, 10)},
+		":self":           &types.AttributeValueMemberS{Value: workerID},
+		":now":            &types.AttributeValueMemberN{Value: strconv.FormatInt(currentLeaseExpiration, 10)},
+	}
+	if d.options.EnableTTL {
+		updateExpression += ", lease_expiration_ttl = :ttl"
+		values[":ttl"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(leaseExpirationTTL(newLeaseExpiration), 10)}
 	}
-	isActive := false
 
-	for !isActive {
-		time.Sleep(1 * time.Second)
-		if out, err := d.db.DescribeTable(input); err == nil {
-			log.WithField("status", awsutil.StringValue(out.Table.TableStatus)).Debug("got describe table output")
-			if stringPtrToString(out.Table.TableStatus) == "ACTIVE" {
-				isActive = true
-			}
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String(d.tableName),
+		Key: map[string]types.AttributeValue{
+			"shard_id": &types.AttributeValueMemberS{Value: shardID},
+		},
+		UpdateExpression:          aws.String(updateExpression),
+		ConditionExpression:       aws.String("attribute_not_exists(shard_id) OR lease_expiration < :now OR worker_id = :self"),
+		ExpressionAttributeValues: values,
+	}
+	_, err = d.db.UpdateItem(ctx, input)
+	if err != nil {
+		if conditionalCheckFailed(err) {
+			return ErrLeaseNotAcquired
 		}
+		return err
 	}
+
+	return
 }
 
-func (d *dynamo) Checkpoint(shardID, seqNum, leaseExpiration, workerID string) (err error) {
-	attributes := map[string]*dynamodb.AttributeValue{
-		"shard_id": &dynamodb.AttributeValue{
-			S: aws.String(shardID),
-		},
-		"checkpoint": &dynamodb.AttributeValue{
-			S: aws.String(seqNum),
-		},
-		"lease_expiration": &dynamodb.AttributeValue{
-			N: aws.String(leaseExpiration),
-		},
-		"worker_id": &dynamodb.AttributeValue{
-			S: aws.String(workerID),
-		},
+// Checkpoint records the sequence number a worker has processed up to for
+// shardID. The write carries a ConditionExpression that only allows
+// workerID to write while it still holds the lease it was given, so a
+// worker whose lease has already been stolen by another host cannot
+// clobber the new lease-holder's checkpoint.
+func (d *dynamo) Checkpoint(ctx context.Context, shardID, seqNum, leaseExpiration, workerID string) (err error) {
+	item := map[string]types.AttributeValue{
+		"shard_id":         &types.AttributeValueMemberS{Value: shardID},
+		"checkpoint":       &types.AttributeValueMemberS{Value: seqNum},
+		"lease_expiration": &types.AttributeValueMemberN{Value: leaseExpiration},
+		"worker_id":        &types.AttributeValueMemberS{Value: workerID},
+	}
+	if d.options.EnableTTL {
+		if leaseExpirationInt, parseErr := strconv.ParseInt(leaseExpiration, 10, 64); parseErr == nil {
+			item["lease_expiration_ttl"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(leaseExpirationTTL(leaseExpirationInt), 10)}
+		}
 	}
+
 	input := &dynamodb.PutItemInput{
-		TableName: aws.String(d.tableName),
-		Item:      &attributes,
+		TableName:           aws.String(d.tableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(shard_id) OR (worker_id = :self AND lease_expiration = :prev)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":self": &types.AttributeValueMemberS{Value: workerID},
+			":prev": &types.AttributeValueMemberN{Value: leaseExpiration},
+		},
+	}
+	_, err = d.db.PutItem(ctx, input)
+	if err != nil {
+		if conditionalCheckFailed(err) {
+			return ErrLeaseNotAcquired
+		}
+		return err
 	}
-	_, err = d.db.PutItem(input)
 
 	return
 }
 
 // TODO: handling unprocessed records - working? need more shards to test
-func (d *dynamo) GetShardData(shards []string) (shardRecords map[string]*shardRecord, err error) {
+func (d *dynamo) GetShardData(ctx context.Context, shards []string) (shardRecords map[string]*ShardRecord, err error) {
 	funcName := "GetShardData"
-	shardRecords = make(map[string]*shardRecord)
+	shardRecords = make(map[string]*ShardRecord)
 
 	// form the request for the records
-	keys := make([]*map[string]*dynamodb.AttributeValue, len(shards), len(shards))
+	keys := make([]map[string]types.AttributeValue, len(shards))
 	for i, shard := range shards {
-		keys[i] = &map[string]*dynamodb.AttributeValue{
-			"shard_id": &dynamodb.AttributeValue{
-				S: aws.String(shard),
-			},
+		keys[i] = map[string]types.AttributeValue{
+			"shard_id": &types.AttributeValueMemberS{Value: shard},
 		}
 	}
 
-	keysToProcess := &map[string]*dynamodb.KeysAndAttributes{
-		d.tableName: &dynamodb.KeysAndAttributes{
+	keysToProcess := map[string]types.KeysAndAttributes{
+		d.tableName: {
 			Keys:                 keys,
 			ProjectionExpression: aws.String("shard_id,checkpoint,lease_expiration,worker_id"),
-			ConsistentRead:       aws.Boolean(true),
+			ConsistentRead:       aws.Bool(true),
 		},
 	}
 
-	for keysToProcess != nil && len(*keysToProcess) > 0 {
+	for len(keysToProcess) > 0 {
 		input := &dynamodb.BatchGetItemInput{
 			RequestItems: keysToProcess,
 		}
 		var out *dynamodb.BatchGetItemOutput
-		out, err = d.db.BatchGetItem(input)
+		out, err = d.db.BatchGetItem(ctx, input)
 		if err != nil {
 			log.WithFields(log.Fields{
 				"error":    err,
@@ -197,14 +473,14 @@ func (d *dynamo) GetShardData(shards []string) (shardRecords map[string]*shardRe
 		log.WithFields(log.Fields{
 			"function":      funcName,
 			"keysToProcess": keysToProcess,
-			"length":        len(*keysToProcess),
+			"length":        len(keysToProcess),
 		}).Debug("dynamo iteration")
 	}
 
 	return
 }
 
-func (d *dynamo) parseShardData(resp *dynamodb.BatchGetItemOutput) (shardRecords map[string]*shardRecord) {
+func (d *dynamo) parseShardData(resp *dynamodb.BatchGetItemOutput) (shardRecords map[string]*ShardRecord) {
 	funcName := "ParseShardData"
 	if resp == nil {
 		log.WithField("function", funcName).Error("resp is nil")
@@ -214,9 +490,8 @@ func (d *dynamo) parseShardData(resp *dynamodb.BatchGetItemOutput) (shardRecords
 		log.WithField("function", funcName).Error("resp.Responses is nil")
 		return
 	}
-	var records []*map[string]*dynamodb.AttributeValue
-	var ok bool
-	if records, ok = (*resp.Responses)[d.tableName]; !ok {
+	records, ok := resp.Responses[d.tableName]
+	if !ok {
 		log.WithField("function", funcName).Error("could not find table")
 		return
 	}
@@ -227,17 +502,88 @@ func (d *dynamo) parseShardData(resp *dynamodb.BatchGetItemOutput) (shardRecords
 		}).Debug("there are no records in dynamodb")
 	}
 
-	shardRecords = make(map[string]*shardRecord)
+	shardRecords = make(map[string]*ShardRecord)
 	for _, record := range records {
-		shardID := stringPtrToString((*record)["shard_id"].S)
-		leaseExpiration, _ := strconv.ParseInt(stringPtrToString((*record)["lease_expiration"].N), 10, 64)
-		shardRecords[shardID] = &shardRecord{
+		shardID := attributeValueToString(record["shard_id"])
+		leaseExpiration, _ := strconv.ParseInt(attributeValueToString(record["lease_expiration"]), 10, 64)
+		shardRecords[shardID] = &ShardRecord{
 			ShardID:         shardID,
-			Checkpoint:      stringPtrToString((*record)["checkpoint"].S),
+			Checkpoint:      attributeValueToString(record["checkpoint"]),
 			LeaseExpiration: leaseExpiration,
-			WorkerID:        stringPtrToString((*record)["worker_id"].S),
+			WorkerID:        attributeValueToString(record["worker_id"]),
+		}
+	}
+
+	return
+}
+
+// ListLeases returns every shard record currently stored in the lease
+// table, regardless of which worker owns it. It satisfies the
+// Checkpointer interface; see ListAllLeases for the paged Scan this
+// delegates to.
+func (d *dynamo) ListLeases(ctx context.Context) ([]*ShardRecord, error) {
+	return d.ListAllLeases(ctx)
+}
+
+// ListAllLeases scans the entire lease table with a consistent read and
+// returns one ShardRecord per row. Unlike GetShardData, which looks up a
+// known set of shard IDs, this discovers every shard the table knows
+// about, which the lease balancer needs to compute fair shares.
+func (d *dynamo) ListAllLeases(ctx context.Context) (records []*ShardRecord, err error) {
+	funcName := "ListAllLeases"
+	input := &dynamodb.ScanInput{
+		TableName:      aws.String(d.tableName),
+		ConsistentRead: aws.Bool(true),
+	}
+
+	for {
+		var out *dynamodb.ScanOutput
+		out, err = d.db.Scan(ctx, input)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":    err,
+				"function": funcName,
+			}).Error("unable to scan lease table")
+			return
+		}
+
+		for _, item := range out.Items {
+			shardID := attributeValueToString(item["shard_id"])
+			leaseExpiration, _ := strconv.ParseInt(attributeValueToString(item["lease_expiration"]), 10, 64)
+			records = append(records, &ShardRecord{
+				ShardID:         shardID,
+				Checkpoint:      attributeValueToString(item["checkpoint"]),
+				LeaseExpiration: leaseExpiration,
+				WorkerID:        attributeValueToString(item["worker_id"]),
+			})
 		}
+
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
 	}
 
 	return
 }
+
+// Close satisfies the Checkpointer interface. The v2 DynamoDB client has
+// no persistent connection or handle to release.
+func (d *dynamo) Close() error {
+	return nil
+}
+
+// attributeValueToString extracts the string form of a scalar S or N
+// DynamoDB attribute, returning "" for anything else (including nil).
+func attributeValueToString(value types.AttributeValue) string {
+	switch v := value.(type) {
+	case *types.AttributeValueMemberS:
+		return v.Value
+	case *types.AttributeValueMemberN:
+		return v.Value
+	default:
+		return ""
+	}
+}
+
+var _ Checkpointer = (*dynamo)(nil)
@@ -0,0 +1,191 @@
+package kcl
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// fakeDynamoAPI is a minimal dynamoAPI good enough to drive reconcileTable,
+// AcquireLease, and Checkpoint without a live DynamoDB table.
+type fakeDynamoAPI struct {
+	describeTableOutput *dynamodb.DescribeTableOutput
+	ttlEnabled          bool
+	tags                map[string]string
+
+	updateTableCalls   []*dynamodb.UpdateTableInput
+	updateItemCalls    []*dynamodb.UpdateItemInput
+	putItemCalls       []*dynamodb.PutItemInput
+	untagResourceCalls []*dynamodb.UntagResourceInput
+	tagResourceCalls   []*dynamodb.TagResourceInput
+
+	conditionFails bool
+}
+
+func (f *fakeDynamoAPI) CreateTable(ctx context.Context, params *dynamodb.CreateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error) {
+	return &dynamodb.CreateTableOutput{}, nil
+}
+
+func (f *fakeDynamoAPI) DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error) {
+	return f.describeTableOutput, nil
+}
+
+func (f *fakeDynamoAPI) UpdateTable(ctx context.Context, params *dynamodb.UpdateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateTableOutput, error) {
+	f.updateTableCalls = append(f.updateTableCalls, params)
+	return &dynamodb.UpdateTableOutput{}, nil
+}
+
+func (f *fakeDynamoAPI) DescribeTimeToLive(ctx context.Context, params *dynamodb.DescribeTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTimeToLiveOutput, error) {
+	status := types.TimeToLiveStatusDisabled
+	if f.ttlEnabled {
+		status = types.TimeToLiveStatusEnabled
+	}
+	return &dynamodb.DescribeTimeToLiveOutput{
+		TimeToLiveDescription: &types.TimeToLiveDescription{TimeToLiveStatus: status},
+	}, nil
+}
+
+func (f *fakeDynamoAPI) UpdateTimeToLive(ctx context.Context, params *dynamodb.UpdateTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateTimeToLiveOutput, error) {
+	f.ttlEnabled = aws.ToBool(params.TimeToLiveSpecification.Enabled)
+	return &dynamodb.UpdateTimeToLiveOutput{}, nil
+}
+
+func (f *fakeDynamoAPI) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	f.updateItemCalls = append(f.updateItemCalls, params)
+	if f.conditionFails {
+		return nil, &types.ConditionalCheckFailedException{}
+	}
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func (f *fakeDynamoAPI) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	f.putItemCalls = append(f.putItemCalls, params)
+	if f.conditionFails {
+		return nil, &types.ConditionalCheckFailedException{}
+	}
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *fakeDynamoAPI) BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	return &dynamodb.BatchGetItemOutput{}, nil
+}
+
+func (f *fakeDynamoAPI) Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	return &dynamodb.ScanOutput{}, nil
+}
+
+func (f *fakeDynamoAPI) ListTagsOfResource(ctx context.Context, params *dynamodb.ListTagsOfResourceInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ListTagsOfResourceOutput, error) {
+	tags := make([]types.Tag, 0, len(f.tags))
+	for key, value := range f.tags {
+		tags = append(tags, types.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	return &dynamodb.ListTagsOfResourceOutput{Tags: tags}, nil
+}
+
+func (f *fakeDynamoAPI) TagResource(ctx context.Context, params *dynamodb.TagResourceInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TagResourceOutput, error) {
+	f.tagResourceCalls = append(f.tagResourceCalls, params)
+	if f.tags == nil {
+		f.tags = make(map[string]string)
+	}
+	for _, tag := range params.Tags {
+		f.tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	return &dynamodb.TagResourceOutput{}, nil
+}
+
+func (f *fakeDynamoAPI) UntagResource(ctx context.Context, params *dynamodb.UntagResourceInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UntagResourceOutput, error) {
+	f.untagResourceCalls = append(f.untagResourceCalls, params)
+	for _, key := range params.TagKeys {
+		delete(f.tags, key)
+	}
+	return &dynamodb.UntagResourceOutput{}, nil
+}
+
+var _ dynamoAPI = (*fakeDynamoAPI)(nil)
+
+func activeTableOutput() *dynamodb.DescribeTableOutput {
+	return &dynamodb.DescribeTableOutput{
+		Table: &types.TableDescription{
+			TableName:   aws.String("leases"),
+			TableArn:    aws.String("arn:aws:dynamodb:us-east-1:123456789012:table/leases"),
+			TableStatus: types.TableStatusActive,
+			KeySchema: []types.KeySchemaElement{
+				{AttributeName: aws.String("shard_id"), KeyType: types.KeyTypeHash},
+			},
+			BillingModeSummary: &types.BillingModeSummary{BillingMode: types.BillingModeProvisioned},
+		},
+	}
+}
+
+func TestReconcileTableMergesBillingModeAndSSEIntoOneUpdate(t *testing.T) {
+	fake := &fakeDynamoAPI{describeTableOutput: activeTableOutput()}
+	d := newDynamoWithClient(fake, "leases", 5, 5, TableOptions{
+		BillingMode:      types.BillingModePayPerRequest,
+		SSESpecification: &types.SSESpecification{Enabled: aws.Bool(true)},
+	})
+
+	if err := d.reconcileTable(context.Background(), fake.describeTableOutput); err != nil {
+		t.Fatalf("reconcileTable: %v", err)
+	}
+
+	if len(fake.updateTableCalls) != 1 {
+		t.Fatalf("UpdateTable called %d times, want 1 (billing mode and SSE merged into a single call)", len(fake.updateTableCalls))
+	}
+	update := fake.updateTableCalls[0]
+	if update.BillingMode != types.BillingModePayPerRequest {
+		t.Errorf("BillingMode = %v, want PAY_PER_REQUEST", update.BillingMode)
+	}
+	if update.SSESpecification == nil || !aws.ToBool(update.SSESpecification.Enabled) {
+		t.Errorf("SSESpecification = %+v, want Enabled=true", update.SSESpecification)
+	}
+}
+
+func TestReconcileTagsRemovesDrifted(t *testing.T) {
+	fake := &fakeDynamoAPI{
+		describeTableOutput: activeTableOutput(),
+		tags:                map[string]string{"stale": "value", "keep": "value"},
+	}
+	d := newDynamoWithClient(fake, "leases", 5, 5, TableOptions{
+		Tags: []types.Tag{{Key: aws.String("keep"), Value: aws.String("value")}},
+	})
+
+	if err := d.reconcileTags(context.Background(), fake.describeTableOutput.Table.TableArn); err != nil {
+		t.Fatalf("reconcileTags: %v", err)
+	}
+
+	if _, stillPresent := fake.tags["stale"]; stillPresent {
+		t.Errorf("stale tag was not removed: %+v", fake.tags)
+	}
+	if value, ok := fake.tags["keep"]; !ok || value != "value" {
+		t.Errorf("keep tag was dropped: %+v", fake.tags)
+	}
+}
+
+func TestAcquireLeaseRejectsConditionalCheckFailure(t *testing.T) {
+	fake := &fakeDynamoAPI{conditionFails: true}
+	d := newDynamoWithClient(fake, "leases", 5, 5, TableOptions{})
+
+	err := d.AcquireLease(context.Background(), "shard-1", "self", 0, 1000)
+	if err != ErrLeaseNotAcquired {
+		t.Fatalf("AcquireLease() error = %v, want ErrLeaseNotAcquired", err)
+	}
+	if len(fake.updateItemCalls) != 1 {
+		t.Fatalf("UpdateItem called %d times, want 1", len(fake.updateItemCalls))
+	}
+}
+
+func TestCheckpointRejectsConditionalCheckFailure(t *testing.T) {
+	fake := &fakeDynamoAPI{conditionFails: true}
+	d := newDynamoWithClient(fake, "leases", 5, 5, TableOptions{})
+
+	err := d.Checkpoint(context.Background(), "shard-1", "seq-1", "1000", "self")
+	if err != ErrLeaseNotAcquired {
+		t.Fatalf("Checkpoint() error = %v, want ErrLeaseNotAcquired", err)
+	}
+	if len(fake.putItemCalls) != 1 {
+		t.Fatalf("PutItem called %d times, want 1", len(fake.putItemCalls))
+	}
+}
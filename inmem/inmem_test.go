@@ -0,0 +1,111 @@
+package inmem
+
+import (
+	"context"
+	"testing"
+
+	kcl "github.com/suicidejack/kinesis_client_library"
+)
+
+func TestAcquireLease(t *testing.T) {
+	ctx := context.Background()
+	now := int64(1000)
+
+	cases := []struct {
+		name    string
+		seed    func(c *Checkpointer)
+		wantErr error
+	}{
+		{
+			name: "unowned shard is acquired",
+		},
+		{
+			name: "expired peer lease is stolen",
+			seed: func(c *Checkpointer) {
+				if err := c.AcquireLease(ctx, "shard-1", "peer", now-1, now-1); err != nil {
+					t.Fatalf("seed AcquireLease: %v", err)
+				}
+			},
+		},
+		{
+			name: "live peer lease is kept",
+			seed: func(c *Checkpointer) {
+				if err := c.AcquireLease(ctx, "shard-1", "peer", now-1, now+1000); err != nil {
+					t.Fatalf("seed AcquireLease: %v", err)
+				}
+			},
+			wantErr: kcl.ErrLeaseNotAcquired,
+		},
+		{
+			name: "renewal by the current owner succeeds",
+			seed: func(c *Checkpointer) {
+				if err := c.AcquireLease(ctx, "shard-1", "self", now-1, now+1000); err != nil {
+					t.Fatalf("seed AcquireLease: %v", err)
+				}
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := New()
+			if tc.seed != nil {
+				tc.seed(c)
+			}
+
+			err := c.AcquireLease(ctx, "shard-1", "self", now, now+1000)
+			if err != tc.wantErr {
+				t.Fatalf("AcquireLease() error = %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	c := New()
+
+	if err := c.AcquireLease(ctx, "shard-1", "self", 0, 1000); err != nil {
+		t.Fatalf("AcquireLease: %v", err)
+	}
+
+	if err := c.Checkpoint(ctx, "shard-1", "seq-1", "1000", "self"); err != nil {
+		t.Fatalf("Checkpoint with the current lease: %v", err)
+	}
+
+	if err := c.Checkpoint(ctx, "shard-1", "seq-2", "1000", "someone-else"); err != kcl.ErrLeaseNotAcquired {
+		t.Fatalf("Checkpoint from a non-owner: got %v, want ErrLeaseNotAcquired", err)
+	}
+
+	if err := c.Checkpoint(ctx, "shard-1", "seq-2", "999", "self"); err != kcl.ErrLeaseNotAcquired {
+		t.Fatalf("Checkpoint against a stale lease_expiration: got %v, want ErrLeaseNotAcquired", err)
+	}
+
+	records, err := c.GetShardData(ctx, []string{"shard-1"})
+	if err != nil {
+		t.Fatalf("GetShardData: %v", err)
+	}
+	if got := records["shard-1"].Checkpoint; got != "seq-1" {
+		t.Fatalf("Checkpoint = %q, want %q", got, "seq-1")
+	}
+}
+
+func TestListLeases(t *testing.T) {
+	ctx := context.Background()
+	c := New()
+
+	if err := c.AcquireLease(ctx, "shard-1", "worker-a", 0, 1000); err != nil {
+		t.Fatalf("AcquireLease shard-1: %v", err)
+	}
+	if err := c.AcquireLease(ctx, "shard-2", "worker-b", 0, 1000); err != nil {
+		t.Fatalf("AcquireLease shard-2: %v", err)
+	}
+
+	leases, err := c.ListLeases(ctx)
+	if err != nil {
+		t.Fatalf("ListLeases: %v", err)
+	}
+	if len(leases) != 2 {
+		t.Fatalf("ListLeases returned %d leases, want 2", len(leases))
+	}
+}
@@ -0,0 +1,48 @@
+package kcl
+
+import "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+// leaseExpirationTTLAttribute is the attribute DynamoDB's TTL sweeper
+// watches to garbage-collect rows for shards that have been deleted or
+// merged away, so the lease table doesn't grow unbounded.
+const leaseExpirationTTLAttribute = "lease_expiration_ttl"
+
+// leaseExpirationTTLGraceSeconds is added on top of a lease's own
+// expiration when stamping lease_expiration_ttl, so DynamoDB doesn't
+// sweep a row the moment its lease lapses - only once it's gone that long
+// without being renewed or reclaimed, which means the shard is gone too.
+const leaseExpirationTTLGraceSeconds = 24 * 60 * 60
+
+// leaseExpirationTTL returns the epoch-second value to stamp into
+// lease_expiration_ttl given a lease's expiration timestamp.
+func leaseExpirationTTL(leaseExpiration int64) int64 {
+	return leaseExpiration + leaseExpirationTTLGraceSeconds
+}
+
+// TableOptions controls how the lease table is created and kept in sync
+// by ValidateTable. The zero value provisions a PROVISIONED-mode table
+// with no SSE, tags, or TTL, matching the table this package has always
+// created.
+type TableOptions struct {
+	// BillingMode is PROVISIONED or PAY_PER_REQUEST. Defaults to
+	// PROVISIONED when empty.
+	BillingMode types.BillingMode
+
+	// SSESpecification enables server-side encryption when set.
+	SSESpecification *types.SSESpecification
+
+	// Tags are applied to the table at creation time.
+	Tags []types.Tag
+
+	// EnableTTL turns on a TimeToLiveSpecification for the
+	// lease_expiration_ttl attribute so rows for deleted/merged shards
+	// are reaped automatically.
+	EnableTTL bool
+}
+
+func (o TableOptions) billingMode() types.BillingMode {
+	if o.BillingMode == "" {
+		return types.BillingModeProvisioned
+	}
+	return o.BillingMode
+}
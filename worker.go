@@ -0,0 +1,42 @@
+package kcl
+
+import "context"
+
+// Worker coordinates shard processing against a Checkpointer backend. It
+// is deliberately backend-agnostic: callers choose a dynamo, inmem, or
+// boltdb Checkpointer (or their own implementation) and hand it in here
+// rather than the worker constructing one itself.
+type Worker struct {
+	workerID     string
+	checkpointer Checkpointer
+	balancer     *leaseBalancer
+}
+
+// NewWorker creates a Worker identified by workerID and backed by the
+// given Checkpointer. Pass a zero BalancerConfig to disable automatic
+// lease rebalancing.
+func NewWorker(workerID string, checkpointer Checkpointer, balancerConfig BalancerConfig) *Worker {
+	w := &Worker{
+		workerID:     workerID,
+		checkpointer: checkpointer,
+	}
+	if balancerConfig.RebalanceInterval > 0 {
+		w.balancer = newLeaseBalancer(checkpointer, workerID, balancerConfig)
+	}
+	return w
+}
+
+// Checkpointer returns the backend this worker was constructed with.
+func (w *Worker) Checkpointer() Checkpointer {
+	return w.checkpointer
+}
+
+// StartBalancing runs the lease balancer until ctx is cancelled. It is a
+// no-op if the worker was constructed with a zero BalancerConfig. Callers
+// typically run this in its own goroutine alongside shard processing.
+func (w *Worker) StartBalancing(ctx context.Context) {
+	if w.balancer == nil {
+		return
+	}
+	w.balancer.run(ctx)
+}